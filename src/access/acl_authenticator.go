@@ -0,0 +1,33 @@
+package access
+
+// aclAuthenticator is the built-in authenticator backed by the
+// collection's IP/referrer allow-list, i.e. the same CheckAccess logic
+// that used to be inlined in handlerStruct.ServeHTTP. It defers to the
+// next authenticator whenever the allow-list doesn't grant access
+// outright — whether CheckAccess wants password authentication or simply
+// has no matching rule — so a Basic or bearer-token authenticator further
+// down the chain still gets a chance to grant access. RunChain already
+// denies a request that runs off the end of the chain, so aclAuthenticator
+// never needs to be the one to say no.
+type aclAuthenticator struct{}
+
+// NewACLAuthenticator returns the built-in IP/referrer allow-list
+// authenticator.
+func NewACLAuthenticator() Authenticator {
+	return aclAuthenticator{}
+}
+
+func (aclAuthenticator) Authenticate(ctx AuthContext) (Decision, error) {
+	status, err := CheckAccess(ctx.Required, ctx.AccessControl, ctx.Path,
+		ctx.RequesterIP)
+	if err != nil {
+		return Deny, err
+	}
+
+	switch status {
+	case Allowed:
+		return Allow, nil
+	default:
+		return Continue, nil
+	}
+}
@@ -0,0 +1,64 @@
+package access
+
+import "net"
+
+// Decision is the verdict an Authenticator hands back for one link in
+// the chain: grant access outright, refuse it outright, or defer to the
+// next authenticator in the chain.
+type Decision int
+
+const (
+	// Continue defers the decision to the next Authenticator in the
+	// chain. An authenticator that didn't see credentials it understands
+	// (e.g. no Authorization header) should return this rather than Deny.
+	Continue Decision = iota
+	// Allow grants access immediately; no further authenticators run.
+	Allow
+	// Deny refuses access immediately; no further authenticators run.
+	Deny
+)
+
+// AuthContext carries everything an Authenticator needs to evaluate one
+// request, so the chain itself stays storage- and transport-agnostic.
+type AuthContext struct {
+	Path           string
+	CollectionName string
+	AccessControl  AccessControlType
+	Required       AccessType
+	RequesterIP    net.IP
+	Referrer       string
+	BasicUser      string
+	BasicPassword  string
+	BasicOK        bool
+	BearerToken    string
+}
+
+// Authenticator is one link in an ordered authentication chain. The
+// chain is evaluated in order; the first non-Continue verdict wins.
+type Authenticator interface {
+	Authenticate(ctx AuthContext) (Decision, error)
+}
+
+// AuthenticatorFunc adapts a plain function to the Authenticator interface.
+type AuthenticatorFunc func(ctx AuthContext) (Decision, error)
+
+// Authenticate implements Authenticator.
+func (f AuthenticatorFunc) Authenticate(ctx AuthContext) (Decision, error) {
+	return f(ctx)
+}
+
+// RunChain evaluates authenticators in order, returning the first
+// non-Continue verdict. If every authenticator defers, the request is
+// denied: an empty or exhausted chain is never implicitly permissive.
+func RunChain(authenticators []Authenticator, ctx AuthContext) (Decision, error) {
+	for _, authenticator := range authenticators {
+		decision, err := authenticator.Authenticate(ctx)
+		if err != nil {
+			return Deny, err
+		}
+		if decision != Continue {
+			return decision, nil
+		}
+	}
+	return Deny, nil
+}
@@ -0,0 +1,170 @@
+package access
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func alwaysDecide(decision Decision, err error) Authenticator {
+	return AuthenticatorFunc(func(ctx AuthContext) (Decision, error) {
+		return decision, err
+	})
+}
+
+func TestRunChainFirstNonContinueWins(t *testing.T) {
+	chain := []Authenticator{
+		alwaysDecide(Continue, nil),
+		alwaysDecide(Allow, nil),
+		alwaysDecide(Deny, nil), // should never run
+	}
+
+	decision, err := RunChain(chain, AuthContext{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if decision != Allow {
+		t.Fatalf("got %v, want Allow", decision)
+	}
+}
+
+func TestRunChainExhaustedChainDenies(t *testing.T) {
+	chain := []Authenticator{alwaysDecide(Continue, nil), alwaysDecide(Continue, nil)}
+
+	decision, err := RunChain(chain, AuthContext{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if decision != Deny {
+		t.Fatalf("got %v, want Deny for an exhausted chain", decision)
+	}
+}
+
+func TestRunChainEmptyChainDenies(t *testing.T) {
+	decision, err := RunChain(nil, AuthContext{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if decision != Deny {
+		t.Fatalf("got %v, want Deny for an empty chain", decision)
+	}
+}
+
+func TestRunChainStopsOnError(t *testing.T) {
+	boom := errors.New("boom")
+	chain := []Authenticator{
+		alwaysDecide(Continue, boom),
+		alwaysDecide(Allow, nil), // should never run
+	}
+
+	decision, err := RunChain(chain, AuthContext{})
+	if err != boom {
+		t.Fatalf("got %v, want boom", err)
+	}
+	if decision != Deny {
+		t.Fatalf("got %v, want Deny alongside the error", decision)
+	}
+}
+
+func TestBearerTokenAuthenticatorDefersWhenAbsent(t *testing.T) {
+	authenticator := NewBearerTokenAuthenticator(func(token string) (*TokenInfo, error) {
+		t.Fatalf("lookup should not be called without a bearer token")
+		return nil, nil
+	})
+
+	decision, err := authenticator.Authenticate(AuthContext{Required: Write})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if decision != Continue {
+		t.Fatalf("got %v, want Continue", decision)
+	}
+}
+
+func TestBearerTokenAuthenticatorAllowsMatchingScope(t *testing.T) {
+	info := &TokenInfo{Scopes: []TokenScope{ScopeWrite}, ExpiresAt: time.Now().Add(time.Hour)}
+	authenticator := NewBearerTokenAuthenticator(func(token string) (*TokenInfo, error) {
+		return info, nil
+	})
+
+	decision, err := authenticator.Authenticate(AuthContext{Required: Write, BearerToken: "tok"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if decision != Allow {
+		t.Fatalf("got %v, want Allow", decision)
+	}
+}
+
+func TestBearerTokenAuthenticatorAdminScopeCoversAnything(t *testing.T) {
+	info := &TokenInfo{Scopes: []TokenScope{ScopeAdmin}, ExpiresAt: time.Now().Add(time.Hour)}
+	authenticator := NewBearerTokenAuthenticator(func(token string) (*TokenInfo, error) {
+		return info, nil
+	})
+
+	decision, err := authenticator.Authenticate(AuthContext{Required: Delete, BearerToken: "tok"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if decision != Allow {
+		t.Fatalf("got %v, want Allow", decision)
+	}
+}
+
+func TestBearerTokenAuthenticatorDeniesExpired(t *testing.T) {
+	info := &TokenInfo{Scopes: []TokenScope{ScopeAdmin}, ExpiresAt: time.Now().Add(-time.Hour)}
+	authenticator := NewBearerTokenAuthenticator(func(token string) (*TokenInfo, error) {
+		return info, nil
+	})
+
+	decision, err := authenticator.Authenticate(AuthContext{Required: Read, BearerToken: "tok"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if decision != Deny {
+		t.Fatalf("got %v, want Deny for an expired token", decision)
+	}
+}
+
+func TestACLThenBearerChainFallsThroughOnNoMatchingRule(t *testing.T) {
+	// A collection with no IP/referrer rule covering this request must
+	// still let a later authenticator in the chain grant access: the
+	// IP/referrer allow-list isn't the only way in.
+	info := &TokenInfo{Scopes: []TokenScope{ScopeWrite}, ExpiresAt: time.Now().Add(time.Hour)}
+	chain := []Authenticator{
+		NewACLAuthenticator(),
+		NewBearerTokenAuthenticator(func(token string) (*TokenInfo, error) {
+			return info, nil
+		}),
+	}
+
+	ctx := AuthContext{
+		Required:    Write,
+		RequesterIP: net.ParseIP("203.0.113.9"),
+		BearerToken: "tok",
+	}
+
+	decision, err := RunChain(chain, ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if decision != Allow {
+		t.Fatalf("got %v, want Allow: a valid bearer token must still be reachable when the allow-list has no matching rule", decision)
+	}
+}
+
+func TestBearerTokenAuthenticatorDeniesWrongScope(t *testing.T) {
+	info := &TokenInfo{Scopes: []TokenScope{ScopeRead}, ExpiresAt: time.Now().Add(time.Hour)}
+	authenticator := NewBearerTokenAuthenticator(func(token string) (*TokenInfo, error) {
+		return info, nil
+	})
+
+	decision, err := authenticator.Authenticate(AuthContext{Required: Delete, BearerToken: "tok"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if decision != Deny {
+		t.Fatalf("got %v, want Deny when the token's scopes don't cover the required access", decision)
+	}
+}
@@ -0,0 +1,37 @@
+package access
+
+import "golang.org/x/crypto/bcrypt"
+
+// BcryptHashLookup resolves the bcrypt hash of a collection's HTTP Basic
+// password. The centraldb-backed implementation stores one hash per
+// collection alongside its other ACL settings.
+type BcryptHashLookup func(collectionName string) (hash []byte, err error)
+
+type basicAuthAuthenticator struct {
+	hashes BcryptHashLookup
+}
+
+// NewBasicAuthAuthenticator returns an Authenticator that grants access
+// when the request carries HTTP Basic credentials matching the
+// collection's stored bcrypt hash. It defers when no Basic credentials
+// are present at all, so it can sit anywhere in the chain.
+func NewBasicAuthAuthenticator(hashes BcryptHashLookup) Authenticator {
+	return basicAuthAuthenticator{hashes: hashes}
+}
+
+func (a basicAuthAuthenticator) Authenticate(ctx AuthContext) (Decision, error) {
+	if !ctx.BasicOK {
+		return Continue, nil
+	}
+
+	hash, err := a.hashes(ctx.CollectionName)
+	if err != nil {
+		return Deny, err
+	}
+
+	if bcrypt.CompareHashAndPassword(hash, []byte(ctx.BasicPassword)) != nil {
+		return Deny, nil
+	}
+
+	return Allow, nil
+}
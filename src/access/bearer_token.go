@@ -0,0 +1,72 @@
+package access
+
+import "time"
+
+// TokenScope is one capability a bearer token can be granted.
+type TokenScope string
+
+// Token scopes, one per AccessType an operator may want to delegate.
+const (
+	ScopeRead   TokenScope = "read"
+	ScopeWrite  TokenScope = "write"
+	ScopeDelete TokenScope = "delete"
+	ScopeAdmin  TokenScope = "admin"
+)
+
+// TokenInfo is what a bearer token resolves to: the scopes it grants and
+// when it stops being valid.
+type TokenInfo struct {
+	Scopes    []TokenScope
+	ExpiresAt time.Time
+}
+
+// BearerTokenLookup resolves an opaque bearer token to its grant, or an
+// error if the token is unknown or revoked.
+type BearerTokenLookup func(token string) (*TokenInfo, error)
+
+type bearerTokenAuthenticator struct {
+	tokens BearerTokenLookup
+}
+
+// NewBearerTokenAuthenticator returns an Authenticator that grants access
+// when the request carries a bearer token whose scopes cover the access
+// class the dispatch entry requires. It defers when no bearer token is
+// present, so it can sit anywhere in the chain.
+func NewBearerTokenAuthenticator(tokens BearerTokenLookup) Authenticator {
+	return bearerTokenAuthenticator{tokens: tokens}
+}
+
+func (a bearerTokenAuthenticator) Authenticate(ctx AuthContext) (Decision, error) {
+	if ctx.BearerToken == "" {
+		return Continue, nil
+	}
+
+	info, err := a.tokens(ctx.BearerToken)
+	if err != nil {
+		return Deny, err
+	}
+
+	if time.Now().After(info.ExpiresAt) {
+		return Deny, nil
+	}
+
+	required := scopeForAccess(ctx.Required)
+	for _, scope := range info.Scopes {
+		if scope == required || scope == ScopeAdmin {
+			return Allow, nil
+		}
+	}
+
+	return Deny, nil
+}
+
+func scopeForAccess(required AccessType) TokenScope {
+	switch required {
+	case Write:
+		return ScopeWrite
+	case Delete:
+		return ScopeDelete
+	default:
+		return ScopeRead
+	}
+}
@@ -0,0 +1,117 @@
+package access
+
+import (
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func fixedLookup(secret []byte) SignedURLKeyLookup {
+	return func(collectionName, keyID string) ([]byte, error) {
+		return secret, nil
+	}
+}
+
+func mintedQuery(t *testing.T, verifier *SignedURLVerifier, secret []byte,
+	method, path string, targetQuery url.Values, contentMD5 string, now time.Time) url.Values {
+	t.Helper()
+
+	canonical := CanonicalQuery(targetQuery)
+	expiresParam := formatExpires(now.Add(time.Minute))
+	signature := Sign(secret, method, path, canonical, expiresParam, contentMD5)
+
+	query := url.Values{}
+	for key, values := range targetQuery {
+		query[key] = values
+	}
+	query.Set(SignatureParam, signature)
+	query.Set(ExpiresParam, expiresParam)
+	query.Set(KeyIDParam, "primary")
+	return query
+}
+
+func formatExpires(t time.Time) string {
+	return strconv.FormatInt(t.Unix(), 10)
+}
+
+func TestSignedURLVerifyRoundTrip(t *testing.T) {
+	secret := []byte("super-secret")
+	verifier := NewSignedURLVerifier(fixedLookup(secret))
+	now := time.Now()
+
+	targetQuery := url.Values{"action": {"finish_upload"}, "upload_id": {"abc123"}}
+	query := mintedQuery(t, verifier, secret, "PUT", "/data/key", targetQuery, "", now)
+
+	if !verifier.Verify("acme", "PUT", "/data/key", query, "", now) {
+		t.Fatalf("expected a freshly minted signature to verify")
+	}
+}
+
+func TestSignedURLVerifyRejectsQueryTamper(t *testing.T) {
+	secret := []byte("super-secret")
+	verifier := NewSignedURLVerifier(fixedLookup(secret))
+	now := time.Now()
+
+	targetQuery := url.Values{"action": {"finish_upload"}, "upload_id": {"abc123"}}
+	query := mintedQuery(t, verifier, secret, "PUT", "/data/key", targetQuery, "", now)
+
+	// Swapping upload_id to someone else's in-progress upload must not
+	// verify against a signature minted for a different upload_id.
+	query.Set("upload_id", "someone-elses-upload")
+
+	if verifier.Verify("acme", "PUT", "/data/key", query, "", now) {
+		t.Fatalf("expected signature to be rejected after query tamper")
+	}
+}
+
+func TestSignedURLVerifyRejectsActionTamper(t *testing.T) {
+	secret := []byte("super-secret")
+	verifier := NewSignedURLVerifier(fixedLookup(secret))
+	now := time.Now()
+
+	targetQuery := url.Values{"action": {"finish_upload"}, "upload_id": {"abc123"}}
+	query := mintedQuery(t, verifier, secret, "PUT", "/data/key", targetQuery, "", now)
+
+	query.Set("action", "abort_upload")
+
+	if verifier.Verify("acme", "PUT", "/data/key", query, "", now) {
+		t.Fatalf("expected signature to be rejected after action tamper")
+	}
+}
+
+func TestSignedURLVerifyRejectsExpired(t *testing.T) {
+	secret := []byte("super-secret")
+	verifier := NewSignedURLVerifier(fixedLookup(secret))
+	now := time.Now()
+
+	targetQuery := url.Values{"action": {"start_upload"}}
+	canonical := CanonicalQuery(targetQuery)
+	expiresParam := strconv.FormatInt(now.Add(-time.Minute).Unix(), 10)
+	signature := Sign(secret, "PUT", "/data/key", canonical, expiresParam, "")
+
+	query := url.Values{"action": {"start_upload"}}
+	query.Set(SignatureParam, signature)
+	query.Set(ExpiresParam, expiresParam)
+	query.Set(KeyIDParam, "primary")
+
+	if verifier.Verify("acme", "PUT", "/data/key", query, "", now) {
+		t.Fatalf("expected an expired signature to be rejected")
+	}
+}
+
+func TestSignedURLVerifyRejectsReplay(t *testing.T) {
+	secret := []byte("super-secret")
+	verifier := NewSignedURLVerifier(fixedLookup(secret))
+	now := time.Now()
+
+	targetQuery := url.Values{"action": {"start_upload"}}
+	query := mintedQuery(t, verifier, secret, "PUT", "/data/key", targetQuery, "", now)
+
+	if !verifier.Verify("acme", "PUT", "/data/key", query, "", now) {
+		t.Fatalf("expected the first use to verify")
+	}
+	if verifier.Verify("acme", "PUT", "/data/key", query, "", now) {
+		t.Fatalf("expected a replayed signature to be rejected")
+	}
+}
@@ -0,0 +1,64 @@
+// Package events publishes structured lifecycle events for archive and
+// conjoined-archive writes and deletes over a ZeroMQ PUB socket, so
+// downstream services (space accounting, garbage collection, webhook
+// fan-out) can react without polling centraldb.
+package events
+
+import "time"
+
+// EventType names one point in the write/delete lifecycle of a key or a
+// conjoined archive.
+type EventType string
+
+// The lifecycle events webwriter publishes.
+const (
+	ArchiveStarted    EventType = "archive_started"
+	ArchiveFinished   EventType = "archive_finished"
+	KeyDeleted        EventType = "key_deleted"
+	ConjoinedStarted  EventType = "conjoined_started"
+	ConjoinedFinished EventType = "conjoined_finished"
+	ConjoinedAborted  EventType = "conjoined_aborted"
+)
+
+// envelopeVersion is bumped whenever the Envelope field set changes in a
+// way subscribers need to branch on.
+const envelopeVersion = 1
+
+// Envelope is the versioned JSON body published for every lifecycle
+// event.
+type Envelope struct {
+	Version        int       `json:"version"`
+	Type           EventType `json:"type"`
+	RequestID      string    `json:"request_id"`
+	CollectionName string    `json:"collection_name"`
+	Key            string    `json:"key"`
+	Size           int64     `json:"size"`
+	Timestamp      time.Time `json:"timestamp"`
+	RequesterIP    string    `json:"requester_ip"`
+	UnifiedID      string    `json:"unified_id,omitempty"`
+}
+
+// NewEnvelope fills in Version and Timestamp and returns the rest as
+// given.
+func NewEnvelope(eventType EventType, requestID, collectionName, key string,
+	size int64, requesterIP string, unifiedID string) Envelope {
+	return Envelope{
+		Version:        envelopeVersion,
+		Type:           eventType,
+		RequestID:      requestID,
+		CollectionName: collectionName,
+		Key:            key,
+		Size:           size,
+		Timestamp:      time.Now(),
+		RequesterIP:    requesterIP,
+		UnifiedID:      unifiedID,
+	}
+}
+
+// Publisher emits lifecycle events. Publish should not block the request
+// it was called from for long; implementations are expected to be
+// non-blocking or best-effort past a small internal buffer.
+type Publisher interface {
+	Publish(event Envelope) error
+	Close() error
+}
@@ -0,0 +1,71 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+
+	zmq "github.com/pebbe/zmq4"
+)
+
+// zmqPublisher publishes events on a ZMQ PUB socket. Each message is sent
+// as two frames: a topic ("<event type>.<collection name>" plus the
+// trailing topicTerminator, as built by Topic) subscribers can filter on,
+// followed by the JSON envelope.
+type zmqPublisher struct {
+	socket *zmq.Socket
+}
+
+// NewPublisher binds a PUB socket at bindAddress (e.g.
+// "tcp://127.0.0.1:8900") and returns a Publisher that writes to it.
+func NewPublisher(bindAddress string) (Publisher, error) {
+	socket, err := zmq.NewSocket(zmq.PUB)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create PUB socket: %s", err)
+	}
+
+	if err := socket.Bind(bindAddress); err != nil {
+		socket.Close()
+		return nil, fmt.Errorf("unable to bind PUB socket to %s: %s",
+			bindAddress, err)
+	}
+
+	return &zmqPublisher{socket: socket}, nil
+}
+
+// Publish implements Publisher.
+func (p *zmqPublisher) Publish(event Envelope) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("unable to marshal event: %s", err)
+	}
+
+	topic := Topic(event.Type, event.CollectionName)
+	if _, err := p.socket.SendMessage(topic, payload); err != nil {
+		return fmt.Errorf("unable to publish event: %s", err)
+	}
+
+	return nil
+}
+
+// Close implements Publisher.
+func (p *zmqPublisher) Close() error {
+	return p.socket.Close()
+}
+
+// topicTerminator ends every topic Topic builds. ZMQ's SetSubscribe match
+// is a raw byte-prefix test, so without a terminator a subscription meant
+// for one collection (e.g. "archive_finished.acme") would also match any
+// other collection whose name happens to start with it
+// ("archive_finished.acme-other") — a cross-tenant event leak. Appending
+// a byte that can't appear in an EventType or collection name closes that
+// off: the only topic "archive_finished.acme\x00" is ever a prefix of is
+// itself.
+const topicTerminator = "\x00"
+
+// Topic builds the topic frame a subscriber filters on. Subscribing to
+// "" matches everything, to string(eventType)+"." matches one event type
+// across all collections, and to the full topic (as built by Topic)
+// matches one event type for exactly one collection.
+func Topic(eventType EventType, collectionName string) string {
+	return fmt.Sprintf("%s.%s%s", eventType, collectionName, topicTerminator)
+}
@@ -0,0 +1,71 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+
+	zmq "github.com/pebbe/zmq4"
+)
+
+// Subscriber is the SUB-side counterpart to Publisher, letting downstream
+// services (space accounting, garbage collection, webhook fan-out) watch
+// the write/delete lifecycle without polling centraldb.
+type Subscriber struct {
+	socket *zmq.Socket
+}
+
+// NewSubscriber connects a SUB socket to connectAddress and subscribes to
+// each of topicPrefixes (e.g. "archive_finished." for one event type
+// across all collections, or events.Topic(ArchiveFinished, "mycollection")
+// for one event type in exactly one collection — build it with Topic
+// rather than concatenating the name by hand, since Topic's trailing
+// terminator is what stops "mycollection" from also matching
+// "mycollection-2"). Subscribing to "" matches every event.
+func NewSubscriber(connectAddress string, topicPrefixes ...string) (*Subscriber, error) {
+	socket, err := zmq.NewSocket(zmq.SUB)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create SUB socket: %s", err)
+	}
+
+	if err := socket.Connect(connectAddress); err != nil {
+		socket.Close()
+		return nil, fmt.Errorf("unable to connect SUB socket to %s: %s",
+			connectAddress, err)
+	}
+
+	if len(topicPrefixes) == 0 {
+		topicPrefixes = []string{""}
+	}
+	for _, prefix := range topicPrefixes {
+		if err := socket.SetSubscribe(prefix); err != nil {
+			socket.Close()
+			return nil, fmt.Errorf("unable to subscribe to %q: %s", prefix, err)
+		}
+	}
+
+	return &Subscriber{socket: socket}, nil
+}
+
+// Next blocks for the next matching event.
+func (s *Subscriber) Next() (Envelope, error) {
+	var event Envelope
+
+	parts, err := s.socket.RecvMessage(0)
+	if err != nil {
+		return event, fmt.Errorf("unable to receive event: %s", err)
+	}
+	if len(parts) != 2 {
+		return event, fmt.Errorf("unexpected frame count %d", len(parts))
+	}
+
+	if err := json.Unmarshal([]byte(parts[1]), &event); err != nil {
+		return event, fmt.Errorf("unable to unmarshal event: %s", err)
+	}
+
+	return event, nil
+}
+
+// Close closes the underlying socket.
+func (s *Subscriber) Close() error {
+	return s.socket.Close()
+}
@@ -0,0 +1,19 @@
+// Package apierr defines the stable set of error codes webwriter returns
+// in its JSON error bodies, so clients can branch on a code rather than
+// on an HTTP status or a free-text message.
+package apierr
+
+// Code is a stable, machine-readable error identifier.
+type Code string
+
+// The error codes ServeHTTP can return.
+const (
+	UnparsableRequest       Code = "unparsable_request"
+	UnknownRequestType      Code = "unknown_request_type"
+	UnknownCollection       Code = "unknown_collection"
+	AccessControlLoadFailed Code = "access_control_load_failed"
+	RequesterIPUnavailable  Code = "requester_ip_unavailable"
+	AuthenticationAborted   Code = "authentication_check_aborted"
+	AccessForbidden         Code = "access_forbidden"
+	HandlerFailed           Code = "handler_failed"
+)
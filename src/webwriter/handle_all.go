@@ -6,13 +6,17 @@ import (
 	"net"
 	"net/http"
 	"strings"
+	"time"
 
 	"access"
 	"centraldb"
+	"events"
 	"types"
 
+	"webwriter/apierr"
 	"webwriter/handler"
 	"webwriter/req"
+	"webwriter/uploadstate"
 )
 
 type handlerEntry struct {
@@ -21,19 +25,55 @@ type handlerEntry struct {
 }
 
 type handlerStruct struct {
-	CentralDB centraldb.CentralDB
-	Dispatch  map[req.RequestType]handlerEntry
+	CentralDB      centraldb.CentralDB
+	UploadStore    uploadstate.Store
+	SignedURLKeys  access.SignedURLKeyLookup
+	SignedURLs     *access.SignedURLVerifier
+	Authenticators []access.Authenticator
+	Events         events.Publisher
+	TrustedProxies []*net.IPNet
+	Dispatch       map[req.RequestType]handlerEntry
+}
+
+// lifecycleEvents maps request types that mark a point in the
+// write/delete lifecycle to the event published on success. Request
+// types not in this map (e.g. AppendUpload, UploadStatus) are plumbing
+// steps rather than lifecycle milestones and publish nothing.
+var lifecycleEvents = map[req.RequestType]events.EventType{
+	req.ArchiveKey:      events.ArchiveFinished,
+	req.DeleteKey:       events.KeyDeleted,
+	req.StartUpload:     events.ArchiveStarted,
+	req.FinishUpload:    events.ArchiveFinished,
+	req.StartConjoined:  events.ConjoinedStarted,
+	req.FinishConjoined: events.ConjoinedFinished,
+	req.AbortConjoined:  events.ConjoinedAborted,
 }
 
 var (
 	forwardedForKey = http.CanonicalHeaderKey("x-forwarded-for")
+	forwardedKey    = http.CanonicalHeaderKey("forwarded")
 	refererKey      = http.CanonicalHeaderKey("referer")
 )
 
 // NewHandler returns an entity that implements the http.Handler interface
 // this handles all incoming requests
-func NewHandler(centralDB centraldb.CentralDB) http.Handler {
-	h := handlerStruct{CentralDB: centralDB}
+func NewHandler(centralDB centraldb.CentralDB, uploadStore uploadstate.Store,
+	signedURLKeys access.SignedURLKeyLookup, basicAuthHashes access.BcryptHashLookup,
+	bearerTokens access.BearerTokenLookup, eventPublisher events.Publisher,
+	trustedProxies []*net.IPNet) http.Handler {
+	h := handlerStruct{
+		CentralDB:     centralDB,
+		UploadStore:   uploadStore,
+		SignedURLKeys: signedURLKeys,
+		SignedURLs:    access.NewSignedURLVerifier(signedURLKeys),
+		Authenticators: []access.Authenticator{
+			access.NewACLAuthenticator(),
+			access.NewBasicAuthAuthenticator(basicAuthHashes),
+			access.NewBearerTokenAuthenticator(bearerTokens),
+		},
+		Events:         eventPublisher,
+		TrustedProxies: trustedProxies,
+	}
 	h.Dispatch = map[req.RequestType]handlerEntry{
 		req.RespondToPing: handlerEntry{Func: handler.RespondToPing,
 			Access: access.NoAccess},
@@ -46,6 +86,18 @@ func NewHandler(centralDB centraldb.CentralDB) http.Handler {
 		req.FinishConjoined: handlerEntry{Func: handler.FinishConjoined,
 			Access: access.Write},
 		req.AbortConjoined: handlerEntry{Func: handler.AbortConjoined,
+			Access: access.Write},
+		req.StartUpload: handlerEntry{Func: handler.NewStartUpload(uploadStore),
+			Access: access.Write},
+		req.AppendUpload: handlerEntry{Func: handler.NewAppendUpload(uploadStore),
+			Access: access.Write},
+		req.FinishUpload: handlerEntry{Func: handler.NewFinishUpload(uploadStore),
+			Access: access.Write},
+		req.AbortUpload: handlerEntry{Func: handler.NewAbortUpload(uploadStore),
+			Access: access.Write},
+		req.UploadStatus: handlerEntry{Func: handler.NewUploadStatus(uploadStore),
+			Access: access.Write},
+		req.MintSignedURL: handlerEntry{Func: handler.NewMintSignedURL(signedURLKeys, access.Write),
 			Access: access.Write}}
 	return &h
 }
@@ -58,6 +110,12 @@ func NewHandler(centralDB centraldb.CentralDB) http.Handler {
 // https://<collection name>.nimbus.io/conjoined/<key>?action=start
 // https://<collection name>.nimbus.io/conjoined/<key>?action=finish&conjoined_identifier=<conjoined_identifier>
 // https://<collection name>.nimbus.io/conjoined/<key>?action=abort&conjoined_identifier=<conjoined_identifier>
+// https://<collection name>.nimbus.io/data/<key>?action=start_upload
+// https://<collection name>.nimbus.io/data/<key>?action=append_upload&upload_id=<upload_id>  (PATCH, Content-Range)
+// https://<collection name>.nimbus.io/data/<key>?action=finish_upload&upload_id=<upload_id>
+// https://<collection name>.nimbus.io/data/<key>?action=abort_upload&upload_id=<upload_id>
+// https://<collection name>.nimbus.io/data/<key>?action=upload_status&upload_id=<upload_id>
+// https://<collection name>.nimbus.io/signed_url?method=PUT&path=/data/<key>&expires_in=<seconds>
 
 func (h *handlerStruct) ServeHTTP(responseWriter http.ResponseWriter,
 	request *http.Request) {
@@ -69,7 +127,8 @@ func (h *handlerStruct) ServeHTTP(responseWriter http.ResponseWriter,
 	if parsedRequest, err = req.ParseRequest(request); err != nil {
 		log.Printf("error: unparsable request: %s, method='%s'", err,
 			request.Method)
-		http.Error(responseWriter, "unparsable request", http.StatusBadRequest)
+		handler.WriteError(responseWriter, request, parsedRequest,
+			http.StatusBadRequest, apierr.UnparsableRequest, err)
 		return
 	}
 
@@ -84,8 +143,8 @@ func (h *handlerStruct) ServeHTTP(responseWriter http.ResponseWriter,
 	if !ok {
 		// this shouldn't happen
 		log.Printf("error: unknown request type: %s", parsedRequest.Type)
-		http.Error(responseWriter, "unknown request type",
-			http.StatusInternalServerError)
+		handler.WriteError(responseWriter, request, parsedRequest,
+			http.StatusInternalServerError, apierr.UnknownRequestType, nil)
 		return
 	}
 
@@ -103,97 +162,252 @@ func (h *handlerStruct) ServeHTTP(responseWriter http.ResponseWriter,
 	if err != nil {
 		log.Printf("error: unknown collection: %s",
 			parsedRequest.CollectionName)
-		http.Error(responseWriter, "unknown collection", http.StatusNotFound)
+		handler.WriteError(responseWriter, request, parsedRequest,
+			http.StatusNotFound, apierr.UnknownCollection, err)
 		return
 	}
 
 	accessControl, err = access.LoadAccessControl(collectionRow.AccessControl)
 	if err != nil {
 		log.Printf("error: unable to load access control: %s", err)
-		http.Error(responseWriter, "unable to load access control",
-			http.StatusInternalServerError)
+		handler.WriteError(responseWriter, request, parsedRequest,
+			http.StatusInternalServerError, apierr.AccessControlLoadFailed, err)
 		return
 	}
 
-	requesterIP, err := getRequesterIP(request.Header.Get(forwardedForKey))
-	if err != nil {
-		log.Printf("error: unable to get requester IP from headers: %s", err)
-		http.Error(responseWriter, "unable to get requester IP",
-			http.StatusBadRequest)
+	// A valid signed URL bypasses the referrer/IP allow-list and password
+	// auth entirely; it carries its own one-time, time-limited grant.
+	if h.SignedURLs.Verify(parsedRequest.CollectionName, request.Method,
+		request.URL.Path, request.URL.Query(),
+		request.Header.Get("Content-MD5"), time.Now()) {
+		requesterIP, err := getRequesterIP(request, h.TrustedProxies)
+		if err != nil {
+			log.Printf("error: unable to get requester IP from headers: %s", err)
+			handler.WriteError(responseWriter, request, parsedRequest,
+				http.StatusBadRequest, apierr.RequesterIPUnavailable, err)
+			return
+		}
+
+		eventSize := h.lifecycleEventSize(parsedRequest, request)
+		err = dispatchEntry.Func(responseWriter, request, parsedRequest,
+			collectionRow)
+		if err != nil {
+			log.Printf("error: %s handler failed: %s", parsedRequest.Type, err)
+			handler.WriteError(responseWriter, request, parsedRequest,
+				http.StatusInternalServerError, apierr.HandlerFailed, err)
+			return
+		}
+		h.publishLifecycleEvent(parsedRequest, request, eventSize, requesterIP)
 		return
 	}
 
-	referrer, err := getReferer(request.Header.Get(refererKey))
+	requesterIP, err := getRequesterIP(request, h.TrustedProxies)
 	if err != nil {
-		log.Printf("error: unable to get referer: %s", err)
-		http.Error(responseWriter, "unable to get referer",
-			http.StatusBadRequest)
+		log.Printf("error: unable to get requester IP from headers: %s", err)
+		handler.WriteError(responseWriter, request, parsedRequest,
+			http.StatusBadRequest, apierr.RequesterIPUnavailable, err)
 		return
 	}
 
-	accessStatus, err := access.CheckAccess(dispatchEntry.Access,
-		accessControl, request.URL.Path, requesterIP)
+	ctx := access.AuthContext{
+		Path:           request.URL.Path,
+		CollectionName: parsedRequest.CollectionName,
+		AccessControl:  accessControl,
+		Required:       dispatchEntry.Access,
+		RequesterIP:    requesterIP,
+		Referrer:       request.Header.Get(refererKey),
+	}
+	ctx.BasicUser, ctx.BasicPassword, ctx.BasicOK = request.BasicAuth()
+	ctx.BearerToken = bearerTokenFromHeader(request.Header.Get("Authorization"))
 
-	accessGranted := false
-	switch accessStatus {
-	case access.Allowed:
-		accessGranted = true
-	case access.RequiresPasswordAuthentication:
-		accessGranted, err := checkPasswordAuthentication()
-		if err != nil {
-			log.Printf("error: checkPasswordAuthentication failed: %s", err)
-			http.Error(responseWriter, "password check aborted",
-				http.StatusInternalServerError)
-			return
-		}
-	case access.Forbidden:
-	default:
-		log.Printf("error: unknown access: %s", accessStatus)
-		http.Error(responseWriter, "unknown access",
-			http.StatusInternalServerError)
+	decision, err := access.RunChain(h.Authenticators, ctx)
+	if err != nil {
+		log.Printf("error: authentication chain failed: %s", err)
+		handler.WriteError(responseWriter, request, parsedRequest,
+			http.StatusInternalServerError, apierr.AuthenticationAborted, err)
 		return
 	}
 
-	if !accessGranted {
+	if decision != access.Allow {
 		log.Printf("warning: access forbidden")
-		http.Error(responseWriter, "invalid", http.StatusForbidden)
+		handler.WriteError(responseWriter, request, parsedRequest,
+			http.StatusForbidden, apierr.AccessForbidden, nil)
 		return
 	}
 
+	eventSize := h.lifecycleEventSize(parsedRequest, request)
 	err = dispatchEntry.Func(responseWriter, request, parsedRequest,
 		collectionRow)
 	if err != nil {
 		log.Printf("error: %s handler failed: %s", parsedRequest.Type, err)
-		http.Error(responseWriter, "handler failed",
-			http.StatusInternalServerError)
+		handler.WriteError(responseWriter, request, parsedRequest,
+			http.StatusInternalServerError, apierr.HandlerFailed, err)
 		return
 	}
+	h.publishLifecycleEvent(parsedRequest, request, eventSize, requesterIP)
 }
 
-func getRequesterIP(forwardwedForHeader string) (net.IP, error) {
-	if forwardwedForHeader == "" {
-		return nil, fmt.Errorf("no data for %s", forwardedForKey)
+// getRequesterIP finds the real client IP behind any reverse proxies in
+// front of us. X-Forwarded-For and Forwarded hops are walked right to
+// left (nearest proxy first), skipping over addresses that fall inside
+// trustedProxies, since a client can put anything it likes in those
+// headers but our own proxies append truthfully. The first hop outside
+// trustedProxies is taken as the real client. These headers are only
+// honored at all when the direct TCP peer (RemoteAddr) is itself inside
+// trustedProxies; otherwise a client connecting straight to us could
+// forge a chain ending in a trusted-looking address and spoof whatever
+// client IP it likes.
+func getRequesterIP(request *http.Request, trustedProxies []*net.IPNet) (net.IP, error) {
+	peer := net.ParseIP(hopHost(request.RemoteAddr))
+	if peer == nil {
+		return nil, fmt.Errorf("unable to parse remote address %q", request.RemoteAddr)
 	}
 
-	//  the header can have multiple forwards of the form
-	// address1, address2, ...
-	// we want the first one which should be the original sender's
-	forwardSlice := strings.Split(forwardwedForHeader, ", ")
-	addressAndPort := forwardSlice[0]
-	address := strings.Split(addressAndPort, ":")
+	if ipInAny(peer, trustedProxies) {
+		if header := request.Header.Get(forwardedForKey); header != "" {
+			if ip := firstUntrustedIP(strings.Split(header, ","), trustedProxies); ip != nil {
+				return ip, nil
+			}
+		}
 
-	ip := net.ParseIP(address)
-	if ip == nil {
-		return nil, fmt.Errorf("unable to parse address '%s'", address)
+		if header := request.Header.Get(forwardedKey); header != "" {
+			if ip := firstUntrustedIP(forwardedForParams(header), trustedProxies); ip != nil {
+				return ip, nil
+			}
+		}
 	}
 
-	return ip, nil
+	return peer, nil
 }
 
-func getReferer(refererHeader string) (string, error) {
-	// it's OK to not have a referer
-	if len(refererHeader) == 0 {
-		return refererHeader, nil
+// firstUntrustedIP walks hops right to left and returns the first
+// address that doesn't fall inside trustedProxies, or nil if every
+// parseable hop is trusted (or none parse at all).
+func firstUntrustedIP(hops []string, trustedProxies []*net.IPNet) net.IP {
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(hopHost(hops[i]))
+		if ip == nil {
+			continue
+		}
+		if !ipInAny(ip, trustedProxies) {
+			return ip
+		}
 	}
+	return nil
+}
 
+// hopHost strips an optional port from one X-Forwarded-For or Forwarded
+// "for=" hop, handling bracketed IPv6 literals ("[2001:db8::1]:443") as
+// well as bare addresses with no port at all.
+func hopHost(hop string) string {
+	hop = strings.TrimSpace(hop)
+	if host, _, err := net.SplitHostPort(hop); err == nil {
+		return host
+	}
+	return strings.Trim(hop, "[]")
+}
+
+// forwardedForParams extracts the for= parameter of each hop in an RFC
+// 7239 Forwarded header, e.g. `for=192.0.2.1;proto=https, for="[::1]:80"`.
+func forwardedForParams(header string) []string {
+	var hops []string
+	for _, hop := range strings.Split(header, ",") {
+		for _, param := range strings.Split(hop, ";") {
+			param = strings.TrimSpace(param)
+			key, value, ok := strings.Cut(param, "=")
+			if !ok || !strings.EqualFold(strings.TrimSpace(key), "for") {
+				continue
+			}
+			hops = append(hops, strings.Trim(strings.TrimSpace(value), `"`))
+		}
+	}
+	return hops
+}
+
+// ipInAny reports whether ip falls inside any of nets.
+func ipInAny(ip net.IP, nets []*net.IPNet) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// publishLifecycleEvent emits the lifecycle event associated with
+// parsedRequest.Type, if any, once its handler has succeeded. size is the
+// number of archive bytes the event should report; callers resolve it
+// with lifecycleEventSize before the handler runs, since a resumable
+// upload's finish_upload request is a bodyless PUT and the real size
+// only lives in uploadstate by then. requesterIP is the already-resolved
+// client address (getRequesterIP, not request.RemoteAddr), so a deployment
+// behind a reverse proxy reports the real client rather than the proxy.
+func (h *handlerStruct) publishLifecycleEvent(parsedRequest req.ParsedRequest,
+	request *http.Request, size int64, requesterIP net.IP) {
+	eventType, ok := lifecycleEvents[parsedRequest.Type]
+	if !ok || h.Events == nil {
+		return
+	}
+
+	event := events.NewEnvelope(eventType, parsedRequest.RequestID,
+		parsedRequest.CollectionName, keyFromRequestPath(request.URL.Path),
+		size, requesterIP.String(), unifiedEventID(parsedRequest, request))
+
+	if err := h.Events.Publish(event); err != nil {
+		log.Printf("error: unable to publish %s event: %s", eventType, err)
+	}
+}
+
+// unifiedEventID returns the identifier that ties every event for the same
+// archive or conjoined archive together, distinct from RequestID (which
+// only correlates the one HTTP request that happened to trigger the
+// event). Resumable uploads and conjoined archives already carry their
+// own correlating ID in the query string; a one-shot write or delete has
+// no narrower identity than the key itself.
+func unifiedEventID(parsedRequest req.ParsedRequest, request *http.Request) string {
+	query := request.URL.Query()
+	if uploadID := query.Get("upload_id"); uploadID != "" {
+		return uploadID
+	}
+	if conjoinedIdentifier := query.Get("conjoined_identifier"); conjoinedIdentifier != "" {
+		return conjoinedIdentifier
+	}
+	return keyFromRequestPath(request.URL.Path)
+}
+
+// lifecycleEventSize resolves the byte size to report on the lifecycle
+// event a request is about to trigger. A finish_upload request carries no
+// body of its own, so its size must come from the committed upload state
+// instead of Content-Length; every other request type reports its own
+// Content-Length as before.
+func (h *handlerStruct) lifecycleEventSize(parsedRequest req.ParsedRequest,
+	request *http.Request) int64 {
+	if parsedRequest.Type != req.FinishUpload || h.UploadStore == nil {
+		return request.ContentLength
+	}
+
+	upload, err := h.UploadStore.Get(parsedRequest.CollectionName,
+		request.URL.Query().Get("upload_id"))
+	if err != nil {
+		log.Printf("error: unable to look up upload size for event: %s", err)
+		return request.ContentLength
+	}
+	return upload.Committed
+}
+
+func keyFromRequestPath(urlPath string) string {
+	for _, prefix := range []string{"/data/", "/conjoined/"} {
+		if strings.HasPrefix(urlPath, prefix) {
+			return strings.TrimPrefix(urlPath, prefix)
+		}
+	}
+	return urlPath
+}
+
+func bearerTokenFromHeader(authorizationHeader string) string {
+	const prefix = "Bearer "
+	if !strings.HasPrefix(authorizationHeader, prefix) {
+		return ""
+	}
+	return strings.TrimPrefix(authorizationHeader, prefix)
 }
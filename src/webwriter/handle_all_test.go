@@ -0,0 +1,115 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func mustParseCIDR(t *testing.T, cidr string) *net.IPNet {
+	t.Helper()
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		t.Fatalf("bad CIDR %q: %s", cidr, err)
+	}
+	return ipNet
+}
+
+func TestGetRequesterIPNoHeaders(t *testing.T) {
+	request := httptest.NewRequest(http.MethodGet, "/data/key", nil)
+	request.RemoteAddr = "203.0.113.9:51234"
+
+	ip, err := getRequesterIP(request, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if ip.String() != "203.0.113.9" {
+		t.Fatalf("got %s, want 203.0.113.9", ip)
+	}
+}
+
+func TestGetRequesterIPIPv4XForwardedFor(t *testing.T) {
+	request := httptest.NewRequest(http.MethodGet, "/data/key", nil)
+	request.Header.Set("X-Forwarded-For", "198.51.100.5, 203.0.113.9")
+	request.RemoteAddr = "203.0.113.9:51234"
+
+	trustedProxies := []*net.IPNet{mustParseCIDR(t, "203.0.113.0/24")}
+
+	ip, err := getRequesterIP(request, trustedProxies)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if ip.String() != "198.51.100.5" {
+		t.Fatalf("got %s, want 198.51.100.5", ip)
+	}
+}
+
+func TestGetRequesterIPIPv6Bracketed(t *testing.T) {
+	request := httptest.NewRequest(http.MethodGet, "/data/key", nil)
+	request.Header.Set("X-Forwarded-For", "[2001:db8::1]:443, 203.0.113.9")
+	request.RemoteAddr = "203.0.113.9:51234"
+
+	trustedProxies := []*net.IPNet{mustParseCIDR(t, "203.0.113.0/24")}
+
+	ip, err := getRequesterIP(request, trustedProxies)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if ip.String() != "2001:db8::1" {
+		t.Fatalf("got %s, want 2001:db8::1", ip)
+	}
+}
+
+func TestGetRequesterIPMixedChainAllTrustedFallsBackToForwarded(t *testing.T) {
+	request := httptest.NewRequest(http.MethodGet, "/data/key", nil)
+	request.Header.Set("X-Forwarded-For", "203.0.113.1, 203.0.113.2")
+	request.Header.Set("Forwarded", `for=198.51.100.7;proto=https, for="[2001:db8::1]:80"`)
+	request.RemoteAddr = "203.0.113.9:51234"
+
+	trustedProxies := []*net.IPNet{mustParseCIDR(t, "203.0.113.0/24")}
+
+	ip, err := getRequesterIP(request, trustedProxies)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if ip.String() != "2001:db8::1" {
+		t.Fatalf("got %s, want 2001:db8::1", ip)
+	}
+}
+
+func TestGetRequesterIPUntrustedPeerIgnoresHeaders(t *testing.T) {
+	// A client connecting directly (not through a trusted proxy) cannot
+	// use X-Forwarded-For to impersonate an allow-listed address.
+	request := httptest.NewRequest(http.MethodGet, "/data/key", nil)
+	request.Header.Set("X-Forwarded-For", "9.9.9.9, 10.0.0.1")
+	request.RemoteAddr = "1.2.3.4:51234"
+
+	trustedProxies := []*net.IPNet{mustParseCIDR(t, "10.0.0.0/8")}
+
+	ip, err := getRequesterIP(request, trustedProxies)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if ip.String() != "1.2.3.4" {
+		t.Fatalf("got %s, want 1.2.3.4 (the direct peer, not a forged header)", ip)
+	}
+}
+
+func TestGetRequesterIPSpoofedPrefixIsSkipped(t *testing.T) {
+	// An attacker can prepend whatever it likes to the left of the chain;
+	// only the hop nearest our own trusted proxy should be believed.
+	request := httptest.NewRequest(http.MethodGet, "/data/key", nil)
+	request.Header.Set("X-Forwarded-For", "203.0.113.9, 10.0.0.5, 198.51.100.1")
+	request.RemoteAddr = "198.51.100.1:443"
+
+	trustedProxies := []*net.IPNet{mustParseCIDR(t, "198.51.100.0/24")}
+
+	ip, err := getRequesterIP(request, trustedProxies)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if ip.String() != "10.0.0.5" {
+		t.Fatalf("got %s, want 10.0.0.5", ip)
+	}
+}
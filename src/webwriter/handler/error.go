@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"webwriter/apierr"
+	"webwriter/req"
+)
+
+// RequestIDHeader echoes parsedRequest.RequestID on every error response
+// WriteError writes, so ops can correlate a client-reported failure with
+// the debug log line ServeHTTP already emits for that request.
+const RequestIDHeader = "X-Nimbus-Request-ID"
+
+// errorBody is the JSON shape of a WriteError response.
+type errorBody struct {
+	RequestID string                 `json:"request_id"`
+	Code      apierr.Code            `json:"code"`
+	Message   string                 `json:"message"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+}
+
+// WriteError writes a structured error response for parsedRequest. It
+// emits application/json only when request's Accept header explicitly
+// asks for JSON; otherwise it falls back to a plain-text http.Error
+// response whose body is the code itself, for older clients that send no
+// Accept header at all. The message is always the
+// static text for code, never cause's own error text: cause may carry
+// internal detail (a centraldb error, a filesystem path) that's fine to
+// log but not to hand an unauthenticated caller.
+func WriteError(responseWriter http.ResponseWriter, request *http.Request,
+	parsedRequest req.ParsedRequest, status int, code apierr.Code, cause error) {
+	responseWriter.Header().Set(RequestIDHeader, parsedRequest.RequestID)
+
+	if !acceptsJSON(request) {
+		http.Error(responseWriter, string(code), status)
+		return
+	}
+
+	body := errorBody{
+		RequestID: parsedRequest.RequestID,
+		Code:      code,
+		Message:   string(code),
+	}
+
+	responseWriter.Header().Set("Content-Type", "application/json")
+	responseWriter.WriteHeader(status)
+	json.NewEncoder(responseWriter).Encode(body)
+}
+
+// acceptsJSON reports whether request explicitly asked for a JSON
+// response. A missing or wildcard Accept header is treated as "no",
+// since most of webwriter's existing clients predate this structured
+// error format and send no Accept header at all.
+func acceptsJSON(request *http.Request) bool {
+	return strings.Contains(request.Header.Get("Accept"), "json")
+}
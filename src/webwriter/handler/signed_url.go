@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"access"
+	"types"
+
+	"webwriter/req"
+)
+
+// defaultSignedURLKeyID is the key identifier minted URLs are signed
+// under until collections can manage multiple named signing keys.
+const defaultSignedURLKeyID = "primary"
+
+// NewMintSignedURL returns a RequestHandler that signs a single-purpose
+// upload or delete URL for the method, path and query an authenticated
+// owner requests, valid until expires_in seconds from now. The query the
+// target URL will carry (e.g. "action=finish_upload&upload_id=123") is
+// covered by the signature, so a holder of the minted URL can't repoint
+// it at a different action or a different upload_id/conjoined_identifier.
+// maxGrantable is the access class the caller already had to hold to
+// reach this handler (the /signed_url endpoint's own dispatch entry); a
+// mint request is refused if the method it asks to sign for would itself
+// require more than that, so a Write-only credential can't be used to
+// mint a DELETE URL it was never granted.
+func NewMintSignedURL(keys access.SignedURLKeyLookup, maxGrantable access.AccessType) RequestHandler {
+	return func(responseWriter http.ResponseWriter, request *http.Request,
+		parsedRequest req.ParsedRequest, collectionRow types.CollectionRow) error {
+		mintQuery := request.URL.Query()
+		method := mintQuery.Get("method")
+		path := mintQuery.Get("path")
+		contentMD5 := mintQuery.Get("content_md5")
+
+		if method == "" || path == "" {
+			return fmt.Errorf("method and path are required")
+		}
+
+		targetQuery, err := url.ParseQuery(mintQuery.Get("query"))
+		if err != nil {
+			return fmt.Errorf("invalid query: %s", err)
+		}
+
+		if required := requiredAccessForMethod(method, targetQuery); !accessCovers(maxGrantable, required) {
+			return fmt.Errorf("minting a %s signed URL requires more access than this caller holds", method)
+		}
+
+		ttlSeconds, err := strconv.ParseInt(mintQuery.Get("expires_in"), 10, 64)
+		if err != nil || ttlSeconds <= 0 {
+			return fmt.Errorf("invalid expires_in: %q", mintQuery.Get("expires_in"))
+		}
+
+		secret, err := keys(parsedRequest.CollectionName, defaultSignedURLKeyID)
+		if err != nil {
+			return fmt.Errorf("no signing key for %s: %s",
+				parsedRequest.CollectionName, err)
+		}
+
+		canonicalTargetQuery := access.CanonicalQuery(targetQuery)
+
+		expires := time.Now().Add(time.Duration(ttlSeconds) * time.Second).Unix()
+		expiresParam := strconv.FormatInt(expires, 10)
+		signature := access.Sign(secret, method, path, canonicalTargetQuery,
+			expiresParam, contentMD5)
+
+		signedQuery := canonicalTargetQuery
+		if signedQuery != "" {
+			signedQuery += "&"
+		}
+		signedQuery += fmt.Sprintf("%s=%s&%s=%s&%s=%s",
+			access.SignatureParam, signature,
+			access.ExpiresParam, expiresParam,
+			access.KeyIDParam, defaultSignedURLKeyID)
+
+		responseWriter.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintf(responseWriter, "%s?%s\n", path, signedQuery)
+		return nil
+	}
+}
+
+// requiredAccessForMethod resolves the access class the dispatch table
+// would require for a request using method and targetQuery, mirroring
+// handle_all.go's own assignments: a DELETE, or any request carrying
+// action=delete, reaches DeleteKey and needs access.Delete; everything
+// else webwriter routes — archive writes, conjoined/upload starts,
+// finishes and aborts alike — only ever needs access.Write.
+func requiredAccessForMethod(method string, targetQuery url.Values) access.AccessType {
+	if method == http.MethodDelete || targetQuery.Get("action") == "delete" {
+		return access.Delete
+	}
+	return access.Write
+}
+
+// accessCovers reports whether granted is at least as strong as required,
+// ordering nimbus.io's access classes from weakest to strongest as
+// NoAccess, Read, Write, Delete — the same order handle_all.go's dispatch
+// table implies (ping needs NoAccess, plain writes need Write, the one
+// delete endpoint needs Delete).
+func accessCovers(granted, required access.AccessType) bool {
+	return accessRank(granted) >= accessRank(required)
+}
+
+func accessRank(accessType access.AccessType) int {
+	switch accessType {
+	case access.NoAccess:
+		return 0
+	case access.Read:
+		return 1
+	case access.Write:
+		return 2
+	case access.Delete:
+		return 3
+	default:
+		return 3
+	}
+}
@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"types"
+
+	"webwriter/req"
+	"webwriter/uploadstate"
+)
+
+// NewStartUpload returns a RequestHandler that begins a resumable chunked
+// archive upload. It allocates an upload ID in store and tells the client
+// where to PATCH subsequent chunks via the Location header, mirroring the
+// Docker Registry blob-upload handshake.
+func NewStartUpload(store uploadstate.Store) RequestHandler {
+	return func(responseWriter http.ResponseWriter, request *http.Request,
+		parsedRequest req.ParsedRequest, collectionRow types.CollectionRow) error {
+		upload, err := store.Create(parsedRequest.CollectionName, keyFromPath(request.URL.Path))
+		if err != nil {
+			return err
+		}
+
+		responseWriter.Header().Set("Location",
+			uploadLocation(request, "append_upload", upload.ID))
+		responseWriter.Header().Set("Range", "0-0")
+		responseWriter.WriteHeader(http.StatusAccepted)
+		return nil
+	}
+}
+
+// NewAppendUpload returns a RequestHandler that appends the bytes of one
+// PATCH request at the offset declared by its Content-Range header, and
+// reports the new committed offset in the Range response header.
+func NewAppendUpload(store uploadstate.Store) RequestHandler {
+	return func(responseWriter http.ResponseWriter, request *http.Request,
+		parsedRequest req.ParsedRequest, collectionRow types.CollectionRow) error {
+		uploadID := request.URL.Query().Get("upload_id")
+
+		offset, err := contentRangeStart(request.Header.Get("Content-Range"))
+		if err != nil {
+			return fmt.Errorf("invalid Content-Range: %s", err)
+		}
+
+		body, err := readAll(request)
+		if err != nil {
+			return err
+		}
+
+		upload, err := store.Append(parsedRequest.CollectionName, uploadID, offset, body)
+		if err != nil {
+			return err
+		}
+
+		responseWriter.Header().Set("Range",
+			fmt.Sprintf("0-%d", upload.Committed))
+		responseWriter.WriteHeader(http.StatusAccepted)
+		return nil
+	}
+}
+
+// NewFinishUpload returns a RequestHandler that seals an upload, producing
+// the same versioned key the one-shot ArchiveKey handler would have.
+func NewFinishUpload(store uploadstate.Store) RequestHandler {
+	return func(responseWriter http.ResponseWriter, request *http.Request,
+		parsedRequest req.ParsedRequest, collectionRow types.CollectionRow) error {
+		uploadID := request.URL.Query().Get("upload_id")
+
+		upload, err := store.Finish(parsedRequest.CollectionName, uploadID)
+		if err != nil {
+			return err
+		}
+
+		responseWriter.Header().Set("Location", keyLocation(request, upload.Key))
+		responseWriter.WriteHeader(http.StatusCreated)
+		return nil
+	}
+}
+
+// NewAbortUpload returns a RequestHandler that discards an in-progress
+// upload and releases its backend slice handles.
+func NewAbortUpload(store uploadstate.Store) RequestHandler {
+	return func(responseWriter http.ResponseWriter, request *http.Request,
+		parsedRequest req.ParsedRequest, collectionRow types.CollectionRow) error {
+		uploadID := request.URL.Query().Get("upload_id")
+
+		if err := store.Abort(parsedRequest.CollectionName, uploadID); err != nil {
+			return err
+		}
+
+		responseWriter.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+}
+
+// NewUploadStatus returns a RequestHandler that reports the current
+// committed offset of an in-progress upload, so a client that lost its
+// connection mid-PATCH knows where to resume.
+func NewUploadStatus(store uploadstate.Store) RequestHandler {
+	return func(responseWriter http.ResponseWriter, request *http.Request,
+		parsedRequest req.ParsedRequest, collectionRow types.CollectionRow) error {
+		uploadID := request.URL.Query().Get("upload_id")
+
+		upload, err := store.Get(parsedRequest.CollectionName, uploadID)
+		if err != nil {
+			return err
+		}
+
+		responseWriter.Header().Set("Range",
+			fmt.Sprintf("0-%d", upload.Committed))
+		responseWriter.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+}
+
+func keyFromPath(urlPath string) string {
+	return strings.TrimPrefix(path.Dir(urlPath)+"/"+path.Base(urlPath), "/data/")
+}
+
+// uploadLocation builds the URL a client should hit next for one step of
+// the resumable upload flow (append, finish, abort, or status), so the
+// action query param the dispatcher routes on is never dropped.
+func uploadLocation(request *http.Request, action, uploadID string) string {
+	return fmt.Sprintf("%s?action=%s&upload_id=%s", request.URL.Path, action, uploadID)
+}
+
+func keyLocation(request *http.Request, key string) string {
+	return fmt.Sprintf("/data/%s", key)
+}
+
+func readAll(request *http.Request) ([]byte, error) {
+	defer request.Body.Close()
+	return io.ReadAll(request.Body)
+}
+
+func contentRangeStart(contentRange string) (int64, error) {
+	// Content-Range: bytes <start>-<end>/<total>
+	if !strings.HasPrefix(contentRange, "bytes ") {
+		return 0, fmt.Errorf("missing 'bytes ' prefix in %q", contentRange)
+	}
+
+	rangeAndTotal := strings.SplitN(strings.TrimPrefix(contentRange, "bytes "), "/", 2)
+	startAndEnd := strings.SplitN(rangeAndTotal[0], "-", 2)
+
+	return strconv.ParseInt(startAndEnd[0], 10, 64)
+}
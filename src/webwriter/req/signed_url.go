@@ -0,0 +1,6 @@
+package req
+
+// MintSignedURL mints a pre-authorized, HMAC-signed upload or delete URL
+// that an authenticated owner can hand to an anonymous third party, e.g.
+// for browser-side direct uploads without exposing real credentials.
+const MintSignedURL RequestType = iota + 2000
@@ -0,0 +1,14 @@
+package req
+
+// Additional RequestType values for the resumable chunked upload flow.
+// These sit alongside the one-shot ArchiveKey request: a client starts
+// an upload, PATCHes one or more chunks to it, and finally seals it with
+// FinishUpload to obtain the same versioned key ArchiveKey would have
+// produced in a single PUT.
+const (
+	StartUpload RequestType = iota + 1000
+	AppendUpload
+	FinishUpload
+	AbortUpload
+	UploadStatus
+)
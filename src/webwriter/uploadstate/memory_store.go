@@ -0,0 +1,124 @@
+package uploadstate
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+)
+
+// memoryStore is an in-process Store, suitable for a single webwriter
+// instance or for tests. It buffers the whole upload's bytes in memory
+// and does not survive a process restart, unlike the centraldb-backed
+// Store this package is meant to grow once resumable uploads need to
+// outlive a crash of the node handling them.
+type memoryStore struct {
+	mutex   sync.Mutex
+	uploads map[string]*Upload
+}
+
+// NewMemoryStore returns a Store backed by an in-memory map.
+func NewMemoryStore() Store {
+	return &memoryStore{uploads: make(map[string]*Upload)}
+}
+
+// Create implements Store.
+func (s *memoryStore) Create(collectionName, key string) (*Upload, error) {
+	id, err := newUploadID()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	upload := &Upload{ID: id, CollectionName: collectionName, Key: key}
+	s.uploads[id] = upload
+	return copyUpload(upload), nil
+}
+
+// Get implements Store.
+func (s *memoryStore) Get(collectionName, uploadID string) (*Upload, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	upload, ok := s.ownedUpload(collectionName, uploadID)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copyUpload(upload), nil
+}
+
+// Append implements Store.
+func (s *memoryStore) Append(collectionName, uploadID string, offset int64, data []byte) (*Upload, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	upload, ok := s.ownedUpload(collectionName, uploadID)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if offset != upload.Committed {
+		return nil, fmt.Errorf("offset %d does not match committed %d",
+			offset, upload.Committed)
+	}
+
+	upload.Segments = append(upload.Segments, Segment{Offset: offset, Length: int64(len(data))})
+	upload.Data = append(upload.Data, data...)
+	upload.Committed += int64(len(data))
+
+	return copyUpload(upload), nil
+}
+
+// Finish implements Store.
+func (s *memoryStore) Finish(collectionName, uploadID string) (*Upload, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	upload, ok := s.ownedUpload(collectionName, uploadID)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	delete(s.uploads, uploadID)
+	return copyUpload(upload), nil
+}
+
+// Abort implements Store.
+func (s *memoryStore) Abort(collectionName, uploadID string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.ownedUpload(collectionName, uploadID); !ok {
+		return ErrNotFound
+	}
+	delete(s.uploads, uploadID)
+	return nil
+}
+
+// ownedUpload looks uploadID up and reports it only if it belongs to
+// collectionName, so a caller authenticated against one collection can
+// never reach another collection's in-progress upload by guessing or
+// reusing its ID.
+func (s *memoryStore) ownedUpload(collectionName, uploadID string) (*Upload, bool) {
+	upload, ok := s.uploads[uploadID]
+	if !ok || upload.CollectionName != collectionName {
+		return nil, false
+	}
+	return upload, true
+}
+
+func copyUpload(upload *Upload) *Upload {
+	copied := *upload
+	copied.Segments = append([]Segment(nil), upload.Segments...)
+	copied.SliceHandles = append([]string(nil), upload.SliceHandles...)
+	copied.Data = append([]byte(nil), upload.Data...)
+	return &copied
+}
+
+func newUploadID() (string, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("unable to generate upload ID: %s", err)
+	}
+	return hex.EncodeToString(raw), nil
+}
@@ -0,0 +1,127 @@
+package uploadstate
+
+import "testing"
+
+func TestMemoryStoreAppendTracksCommittedOffset(t *testing.T) {
+	store := NewMemoryStore()
+
+	upload, err := store.Create("collection", "some/key")
+	if err != nil {
+		t.Fatalf("Create: %s", err)
+	}
+
+	upload, err = store.Append("collection", upload.ID, 0, []byte("hello"))
+	if err != nil {
+		t.Fatalf("Append: %s", err)
+	}
+	if upload.Committed != 5 {
+		t.Fatalf("got Committed %d, want 5", upload.Committed)
+	}
+
+	if _, err := store.Append("collection", upload.ID, 0, []byte("world")); err == nil {
+		t.Fatalf("Append at a stale offset should have failed")
+	}
+
+	upload, err = store.Append("collection", upload.ID, 5, []byte("world"))
+	if err != nil {
+		t.Fatalf("Append: %s", err)
+	}
+	if upload.Committed != 10 {
+		t.Fatalf("got Committed %d, want 10", upload.Committed)
+	}
+}
+
+func TestMemoryStoreAppendAssemblesContent(t *testing.T) {
+	store := NewMemoryStore()
+
+	upload, err := store.Create("collection", "some/key")
+	if err != nil {
+		t.Fatalf("Create: %s", err)
+	}
+
+	upload, err = store.Append("collection", upload.ID, 0, []byte("hello, "))
+	if err != nil {
+		t.Fatalf("Append: %s", err)
+	}
+	upload, err = store.Append("collection", upload.ID, upload.Committed, []byte("world"))
+	if err != nil {
+		t.Fatalf("Append: %s", err)
+	}
+
+	upload, err = store.Finish("collection", upload.ID)
+	if err != nil {
+		t.Fatalf("Finish: %s", err)
+	}
+	if string(upload.Data) != "hello, world" {
+		t.Fatalf("got assembled content %q, want %q", upload.Data, "hello, world")
+	}
+}
+
+func TestMemoryStoreFinishRemovesUpload(t *testing.T) {
+	store := NewMemoryStore()
+
+	upload, err := store.Create("collection", "some/key")
+	if err != nil {
+		t.Fatalf("Create: %s", err)
+	}
+
+	if _, err := store.Finish("collection", upload.ID); err != nil {
+		t.Fatalf("Finish: %s", err)
+	}
+
+	if _, err := store.Get("collection", upload.ID); err != ErrNotFound {
+		t.Fatalf("got %v, want ErrNotFound after Finish", err)
+	}
+}
+
+func TestMemoryStoreAbortRemovesUpload(t *testing.T) {
+	store := NewMemoryStore()
+
+	upload, err := store.Create("collection", "some/key")
+	if err != nil {
+		t.Fatalf("Create: %s", err)
+	}
+
+	if err := store.Abort("collection", upload.ID); err != nil {
+		t.Fatalf("Abort: %s", err)
+	}
+
+	if err := store.Abort("collection", upload.ID); err != ErrNotFound {
+		t.Fatalf("got %v, want ErrNotFound aborting twice", err)
+	}
+}
+
+func TestMemoryStoreGetUnknownUpload(t *testing.T) {
+	store := NewMemoryStore()
+
+	if _, err := store.Get("collection", "does-not-exist"); err != ErrNotFound {
+		t.Fatalf("got %v, want ErrNotFound", err)
+	}
+}
+
+func TestMemoryStoreRejectsCrossCollectionAccess(t *testing.T) {
+	store := NewMemoryStore()
+
+	upload, err := store.Create("collection-a", "some/key")
+	if err != nil {
+		t.Fatalf("Create: %s", err)
+	}
+
+	if _, err := store.Get("collection-b", upload.ID); err != ErrNotFound {
+		t.Fatalf("got %v, want ErrNotFound reading another collection's upload", err)
+	}
+	if _, err := store.Append("collection-b", upload.ID, 0, []byte("x")); err != ErrNotFound {
+		t.Fatalf("got %v, want ErrNotFound appending to another collection's upload", err)
+	}
+	if _, err := store.Finish("collection-b", upload.ID); err != ErrNotFound {
+		t.Fatalf("got %v, want ErrNotFound finishing another collection's upload", err)
+	}
+	if err := store.Abort("collection-b", upload.ID); err != ErrNotFound {
+		t.Fatalf("got %v, want ErrNotFound aborting another collection's upload", err)
+	}
+
+	// The real owning collection can still reach it.
+	if _, err := store.Get("collection-a", upload.ID); err != nil {
+		t.Fatalf("Get from the owning collection: %s", err)
+	}
+}
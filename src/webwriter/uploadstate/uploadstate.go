@@ -0,0 +1,50 @@
+// Package uploadstate tracks the progress of resumable chunked archive
+// uploads between the initial start_upload request and the terminal
+// finish_upload or abort_upload request, so a client can resume after a
+// dropped connection without restarting the whole PUT.
+package uploadstate
+
+import "fmt"
+
+// Segment records one committed chunk of an in-progress upload.
+type Segment struct {
+	Offset int64
+	Length int64
+}
+
+// Upload is the persisted state of a single resumable upload.
+type Upload struct {
+	ID             string
+	CollectionName string
+	Key            string
+	Committed      int64
+	MD5SoFar       []byte
+	Segments       []Segment
+	SliceHandles   []string
+	// Data holds the committed bytes assembled so far. The in-memory
+	// Store keeps the whole upload here; a centraldb-backed Store would
+	// flush each chunk to its slice store instead and leave this nil.
+	Data []byte
+}
+
+// ErrNotFound is returned by every Store method taking an uploadID when
+// the upload ID is unknown to collectionName — either because it was
+// never created, because it has already been finished or aborted, or
+// because it belongs to a different collection. The same error covers
+// all three so a caller can't use it to probe for the existence of an
+// upload it doesn't hold the matching collection's credentials for.
+var ErrNotFound = fmt.Errorf("upload not found")
+
+// Store persists in-progress uploads. The centraldb-backed implementation
+// is expected to live alongside the rest of the centraldb schema; Store is
+// kept small and storage-agnostic so it can be swapped or faked in tests.
+// Every method but Create takes the collectionName the caller is already
+// authenticated against, so an upload ID obtained for one collection can
+// never be appended to, finished, aborted, or inspected through another.
+type Store interface {
+	Create(collectionName, key string) (*Upload, error)
+	Get(collectionName, uploadID string) (*Upload, error)
+	Append(collectionName, uploadID string, offset int64, data []byte) (*Upload, error)
+	Finish(collectionName, uploadID string) (*Upload, error)
+	Abort(collectionName, uploadID string) error
+}